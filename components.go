@@ -0,0 +1,467 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Todo is a decoded VTODO component.
+type Todo struct {
+	UID                            string
+	Start, Due, Completed          time.Time
+	Summary, Location, Description string
+	Status                         string
+	PercentComplete                int
+	Alarm                          []Alarm
+	Raw                            []Property
+}
+
+// Journal is a decoded VJOURNAL component.
+type Journal struct {
+	UID                  string
+	Start                time.Time
+	Summary, Description string
+	Raw                  []Property
+}
+
+// Period is a span of time, as used by VFREEBUSY's FREEBUSY property.
+type Period struct {
+	Start, End time.Time
+}
+
+// FreeBusy is a decoded VFREEBUSY component.
+type FreeBusy struct {
+	UID        string
+	Start, End time.Time
+	Busy       []Period
+	Raw        []Property
+}
+
+// Alarm is a decoded VALARM sub-component.
+type Alarm struct {
+	Action               string
+	Trigger              AlarmTrigger
+	Summary, Description string
+	Attendee             []string
+	Repeat               int
+	Raw                  []Property
+}
+
+// AlarmTrigger is a decoded TRIGGER property. Either Absolute is set, or
+// Duration is the offset from the owning event's or todo's start (or end,
+// if RelatedEnd) at which the alarm fires.
+type AlarmTrigger struct {
+	Duration   time.Duration
+	RelatedEnd bool
+	Absolute   time.Time
+}
+
+func decodeAlarmTrigger(p Property, lookupTZ func(string) (*time.Location, bool)) (AlarmTrigger, error) {
+	if vs := p.Params["VALUE"]; len(vs) > 0 && vs[0] == "DATE-TIME" {
+		t, err := decodeDateTime(p, lookupTZ)
+		return AlarmTrigger{Absolute: t}, err
+	}
+	d, err := parseDuration(p.Value)
+	if err != nil {
+		return AlarmTrigger{}, err
+	}
+	related := false
+	if rs := p.Params["RELATED"]; len(rs) > 0 && rs[0] == "END" {
+		related = true
+	}
+	return AlarmTrigger{Duration: d, RelatedEnd: related}, nil
+}
+
+func decodeAlarm(r *bufio.Reader, lookupTZ func(string) (*time.Location, bool)) (*Alarm, error) {
+	a := new(Alarm)
+	for {
+		p, err := decodeLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "END":
+			if p.Value != "VALARM" {
+				return nil, errors.New("unexpected END value")
+			}
+			return a, nil
+		case "ACTION":
+			a.Action = p.Value
+		case "TRIGGER":
+			a.Trigger, err = decodeAlarmTrigger(p, lookupTZ)
+		case "SUMMARY":
+			a.Summary = unescapeText(p.Value)
+		case "DESCRIPTION":
+			a.Description = unescapeText(p.Value)
+		case "ATTENDEE":
+			a.Attendee = append(a.Attendee, p.Value)
+		case "REPEAT":
+			a.Repeat, err = strconv.Atoi(p.Value)
+		default:
+			a.Raw = append(a.Raw, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeTodo(r *bufio.Reader, lookupTZ func(string) (*time.Location, bool)) (*Todo, error) {
+	t := new(Todo)
+	for {
+		p, err := decodeLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "BEGIN":
+			if p.Value == "VALARM" {
+				var a *Alarm
+				if a, err = decodeAlarm(r, lookupTZ); err == nil {
+					t.Alarm = append(t.Alarm, *a)
+				}
+			} else {
+				t.Raw = append(t.Raw, p)
+			}
+		case "END":
+			if p.Value != "VTODO" {
+				return nil, errors.New("unexpected END value")
+			}
+			return t, nil
+		case "UID":
+			t.UID = p.Value
+		case "DTSTART":
+			t.Start, err = decodeDateTime(p, lookupTZ)
+		case "DUE":
+			t.Due, err = decodeDateTime(p, lookupTZ)
+		case "COMPLETED":
+			t.Completed, err = decodeDateTime(p, lookupTZ)
+		case "SUMMARY":
+			t.Summary = unescapeText(p.Value)
+		case "LOCATION":
+			t.Location = unescapeText(p.Value)
+		case "DESCRIPTION":
+			t.Description = unescapeText(p.Value)
+		case "STATUS":
+			t.Status = p.Value
+		case "PERCENT-COMPLETE":
+			t.PercentComplete, err = strconv.Atoi(p.Value)
+		default:
+			t.Raw = append(t.Raw, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeJournal(r *bufio.Reader, lookupTZ func(string) (*time.Location, bool)) (*Journal, error) {
+	j := new(Journal)
+	for {
+		p, err := decodeLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "END":
+			if p.Value != "VJOURNAL" {
+				return nil, errors.New("unexpected END value")
+			}
+			return j, nil
+		case "UID":
+			j.UID = p.Value
+		case "DTSTART":
+			j.Start, err = decodeDateTime(p, lookupTZ)
+		case "SUMMARY":
+			j.Summary = unescapeText(p.Value)
+		case "DESCRIPTION":
+			j.Description = unescapeText(p.Value)
+		default:
+			j.Raw = append(j.Raw, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeFreeBusy(r *bufio.Reader, lookupTZ func(string) (*time.Location, bool)) (*FreeBusy, error) {
+	fb := new(FreeBusy)
+	for {
+		p, err := decodeLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "END":
+			if p.Value != "VFREEBUSY" {
+				return nil, errors.New("unexpected END value")
+			}
+			return fb, nil
+		case "UID":
+			fb.UID = p.Value
+		case "DTSTART":
+			fb.Start, err = decodeDateTime(p, lookupTZ)
+		case "DTEND":
+			fb.End, err = decodeDateTime(p, lookupTZ)
+		case "FREEBUSY":
+			periods, perr := decodeFreeBusyValue(p, lookupTZ)
+			if perr != nil {
+				fb.Raw = append(fb.Raw, p)
+				break
+			}
+			fb.Busy = append(fb.Busy, periods...)
+		default:
+			fb.Raw = append(fb.Raw, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decodeFreeBusyValue parses a FREEBUSY property value, a comma-separated
+// list of "start/end" periods where end is either a date-time or a
+// duration relative to start.
+func decodeFreeBusyValue(p Property, lookupTZ func(string) (*time.Location, bool)) ([]Period, error) {
+	var periods []Period
+	for _, part := range strings.Split(p.Value, ",") {
+		se := strings.SplitN(part, "/", 2)
+		if len(se) != 2 {
+			return nil, fmt.Errorf("ics: bad FREEBUSY period %q", part)
+		}
+		start, err := decodeDateTime(Property{Params: p.Params, Value: se[0]}, lookupTZ)
+		if err != nil {
+			return nil, err
+		}
+		var end time.Time
+		if strings.ContainsAny(se[1], "Pp") {
+			d, err := parseDuration(se[1])
+			if err != nil {
+				return nil, err
+			}
+			end = start.Add(d)
+		} else {
+			if end, err = decodeDateTime(Property{Params: p.Params, Value: se[1]}, lookupTZ); err != nil {
+				return nil, err
+			}
+		}
+		periods = append(periods, Period{Start: start, End: end})
+	}
+	return periods, nil
+}
+
+// Timezone is a decoded VTIMEZONE component, capturing the STANDARD and
+// DAYLIGHT rules that describe a zone's UTC offset over time.
+type Timezone struct {
+	TZID               string
+	Standard, Daylight []TimezoneRule
+	Raw                []Property
+}
+
+// TimezoneRule is a single STANDARD or DAYLIGHT sub-component of a
+// VTIMEZONE.
+type TimezoneRule struct {
+	Start                time.Time
+	OffsetFrom, OffsetTo time.Duration
+	RRule                *RecurrenceRule
+	Raw                  []Property
+}
+
+func decodeTimezone(r *bufio.Reader) (*Timezone, error) {
+	tz := new(Timezone)
+	for {
+		p, err := decodeLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "BEGIN":
+			switch p.Value {
+			case "STANDARD":
+				rule, rerr := decodeTimezoneRule(r, "STANDARD")
+				if rerr != nil {
+					return nil, rerr
+				}
+				tz.Standard = append(tz.Standard, *rule)
+			case "DAYLIGHT":
+				rule, rerr := decodeTimezoneRule(r, "DAYLIGHT")
+				if rerr != nil {
+					return nil, rerr
+				}
+				tz.Daylight = append(tz.Daylight, *rule)
+			default:
+				tz.Raw = append(tz.Raw, p)
+			}
+		case "END":
+			if p.Value != "VTIMEZONE" {
+				return nil, errors.New("unexpected END value")
+			}
+			return tz, nil
+		case "TZID":
+			tz.TZID = p.Value
+		default:
+			tz.Raw = append(tz.Raw, p)
+		}
+	}
+}
+
+func decodeTimezoneRule(r *bufio.Reader, kind string) (*TimezoneRule, error) {
+	rule := new(TimezoneRule)
+	for {
+		p, err := decodeLine(r)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "END":
+			if p.Value != kind {
+				return nil, errors.New("unexpected END value")
+			}
+			return rule, nil
+		case "DTSTART":
+			// Local to the zone being defined; there's no TZID to
+			// resolve it against.
+			rule.Start, err = decodeDateTime(p, nil)
+		case "TZOFFSETFROM":
+			rule.OffsetFrom, err = parseOffset(p.Value)
+		case "TZOFFSETTO":
+			rule.OffsetTo, err = parseOffset(p.Value)
+		case "RRULE":
+			rule.RRule, err = parseRecurrenceRule(p.Value)
+		default:
+			rule.Raw = append(rule.Raw, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// location synthesizes a fixed-offset *time.Location for tz, using the
+// offset of whichever rule's most recent transition (applying its RRULE,
+// if any) falls before now. It does not return a time-varying Location,
+// so it can't reproduce historical DST transitions away from the current
+// offset.
+func (tz *Timezone) location() *time.Location {
+	now := time.Now()
+	var best *TimezoneRule
+	var bestTransition time.Time
+	consider := func(rule *TimezoneRule) {
+		transition := rule.Start
+		if rule.RRule != nil {
+			if occ := rule.RRule.expand(rule.Start, rule.Start, now); len(occ) > 0 {
+				transition = occ[len(occ)-1]
+			}
+		}
+		if transition.After(now) {
+			return
+		}
+		if best == nil || transition.After(bestTransition) {
+			best, bestTransition = rule, transition
+		}
+	}
+	for i := range tz.Standard {
+		consider(&tz.Standard[i])
+	}
+	for i := range tz.Daylight {
+		consider(&tz.Daylight[i])
+	}
+	if best == nil {
+		return time.UTC
+	}
+	return time.FixedZone(tz.TZID, int(best.OffsetTo.Seconds()))
+}
+
+// parseOffset parses a UTC offset of the form "+HHMM", "-HHMM", or
+// "+HHMMSS", as used by TZOFFSETFROM and TZOFFSETTO.
+func parseOffset(s string) (time.Duration, error) {
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	}
+	if len(s) != 4 && len(s) != 6 {
+		return 0, fmt.Errorf("ics: bad UTC offset %q", s)
+	}
+	h, err := strconv.Atoi(s[0:2])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(s[2:4])
+	if err != nil {
+		return 0, err
+	}
+	sec := 0
+	if len(s) == 6 {
+		if sec, err = strconv.Atoi(s[4:6]); err != nil {
+			return 0, err
+		}
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseDuration parses an RFC 5545 dur-value, e.g. "-PT15M" or "P1DT2H".
+func parseDuration(s string) (time.Duration, error) {
+	orig := s
+	neg := false
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	if len(s) == 0 || s[0] != 'P' {
+		return 0, fmt.Errorf("ics: bad duration %q", orig)
+	}
+	s = s[1:]
+	var d time.Duration
+	inTime := false
+	num, haveNum := 0, false
+	for len(s) > 0 {
+		c := s[0]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			num, haveNum = num*10+int(c-'0'), true
+		case c == 'W' && !inTime:
+			d += time.Duration(num) * 7 * 24 * time.Hour
+			num, haveNum = 0, false
+		case c == 'D' && !inTime:
+			d += time.Duration(num) * 24 * time.Hour
+			num, haveNum = 0, false
+		case c == 'H' && inTime:
+			d += time.Duration(num) * time.Hour
+			num, haveNum = 0, false
+		case c == 'M' && inTime:
+			d += time.Duration(num) * time.Minute
+			num, haveNum = 0, false
+		case c == 'S' && inTime:
+			d += time.Duration(num) * time.Second
+			num, haveNum = 0, false
+		default:
+			return 0, fmt.Errorf("ics: bad duration %q", orig)
+		}
+		s = s[1:]
+	}
+	if haveNum {
+		return 0, fmt.Errorf("ics: bad duration %q", orig)
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
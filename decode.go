@@ -9,90 +9,141 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"sort"
-	"strings"
 	"time"
 )
 
 type Calendar struct {
-	Event []*Event
+	Event    []*Event
+	Todo     []*Todo
+	Journal  []*Journal
+	FreeBusy []*FreeBusy
+	Timezone []*Timezone
+
+	// Info holds the calendar's PRODID, VERSION, CALSCALE, METHOD, and
+	// X-WR-* properties.
+	Info CalendarInfo
 }
 
 type Event struct {
 	UID                            string
 	Start, End                     time.Time
 	Summary, Location, Description string
+
+	// RRule is the event's recurrence rule, or nil if it doesn't recur.
+	RRule *RecurrenceRule
+	// RDate and ExDate are recurrence dates to add and remove,
+	// respectively, from the set generated by RRule.
+	RDate, ExDate []time.Time
+	// RecurrenceID is set on an event that overrides a single instance of
+	// another event with the same UID, replacing the occurrence whose
+	// original start time is RecurrenceID.
+	RecurrenceID time.Time
+
+	// Alarm holds the event's VALARM sub-components.
+	Alarm []Alarm
+
+	// Raw holds the properties of the event that aren't otherwise
+	// exposed as fields of Event.
+	Raw []Property
 }
 
-func Decode(rd io.Reader) (c *Calendar, err error) {
-	r := bufio.NewReader(rd)
+// Decode reads an entire VCALENDAR into memory. For large feeds, use
+// NewDecoder instead to read one VEVENT at a time.
+func Decode(rd io.Reader) (*Calendar, error) {
+	d := NewDecoder(rd)
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	c := &Calendar{Info: info}
 	for {
-		key, value, err := decodeLine(r)
+		e, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
-		if key == "BEGIN" {
-			if c == nil {
-				if value != "VCALENDAR" {
-					return nil, errors.New("didn't find BEGIN:VCALENDAR")
-				}
-				c = new(Calendar)
-			}
-			if value == "VEVENT" {
-				e, err := decodeEvent(r)
-				if err != nil {
-					return nil, err
-				}
-				c.Event = append(c.Event, e)
-			}
-		}
-		if key == "END" && value == "VCALENDAR" {
-			break
-		}
+		c.Event = append(c.Event, e)
 	}
 	sort.Sort(eventList(c.Event))
+	c.Todo = d.Todos()
+	c.Journal = d.Journals()
+	c.FreeBusy = d.FreeBusy()
+	c.Timezone = d.Timezones()
 	return c, nil
 }
 
-func decodeEvent(r *bufio.Reader) (*Event, error) {
+func decodeEvent(r *bufio.Reader, lookupTZ func(string) (*time.Location, bool)) (*Event, error) {
 	e := new(Event)
-	var key, value string
-	var err error
 	for {
+		p, err := decodeLine(r)
 		if err != nil {
 			return nil, err
 		}
-		key, value, err = decodeLine(r)
-		switch key {
+		switch p.Name {
+		case "BEGIN":
+			if p.Value == "VALARM" {
+				var a *Alarm
+				if a, err = decodeAlarm(r, lookupTZ); err == nil {
+					e.Alarm = append(e.Alarm, *a)
+				}
+			} else {
+				e.Raw = append(e.Raw, p)
+			}
 		case "END":
-			if value != "VEVENT" {
+			if p.Value != "VEVENT" {
 				return nil, errors.New("unexpected END value")
 			}
 			return e, nil
 		case "UID":
-			e.UID = value
+			e.UID = p.Value
 		case "DTSTART":
-			e.Start, err = decodeTime(value)
+			e.Start, err = decodeDateTime(p, lookupTZ)
 		case "DTEND":
-			e.End, err = decodeTime(value)
+			e.End, err = decodeDateTime(p, lookupTZ)
 		case "SUMMARY":
-			e.Summary = value
+			e.Summary = unescapeText(p.Value)
 		case "LOCATION":
-			e.Location = value
+			e.Location = unescapeText(p.Value)
 		case "DESCRIPTION":
-			e.Description = value
+			e.Description = unescapeText(p.Value)
+		case "RRULE":
+			e.RRule, err = parseRecurrenceRule(p.Value)
+		case "RDATE":
+			var ts []time.Time
+			ts, err = decodeDateTimeList(p, lookupTZ)
+			e.RDate = append(e.RDate, ts...)
+		case "EXDATE":
+			var ts []time.Time
+			ts, err = decodeDateTimeList(p, lookupTZ)
+			e.ExDate = append(e.ExDate, ts...)
+		case "RECURRENCE-ID":
+			e.RecurrenceID, err = decodeDateTime(p, lookupTZ)
+		default:
+			e.Raw = append(e.Raw, p)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
-	panic("unreachable")
 }
 
+// decodeTime parses a bare, unparameterized UTC or floating date-time
+// value, as used by RRULE's UNTIL.
 func decodeTime(value string) (time.Time, error) {
-	const layout = "20060102T150405Z"
-	return time.Parse(layout, value)
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ics: bad time value %q", value)
 }
 
-func decodeLine(r *bufio.Reader) (key, value string, err error) {
+func decodeLine(r *bufio.Reader) (Property, error) {
 	var buf bytes.Buffer
 	for {
 		// get full line
@@ -101,13 +152,13 @@ func decodeLine(r *bufio.Reader) (key, value string, err error) {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
 			}
-			return "", "", err
+			return Property{}, err
 		}
 		if isPrefix {
-			return "", "", errors.New("unexpected long line")
+			return Property{}, errors.New("unexpected long line")
 		}
 		if len(b) == 0 {
-			return "", "", errors.New("unexpected blank line")
+			return Property{}, errors.New("unexpected blank line")
 		}
 		if b[0] == ' ' {
 			b = b[1:]
@@ -119,11 +170,80 @@ func decodeLine(r *bufio.Reader) (key, value string, err error) {
 			break
 		}
 	}
-	p := strings.SplitN(buf.String(), ":", 2)
-	if len(p) != 2 {
-		return "", "", errors.New("bad line, couldn't find key:value")
+	return parseContentLine(buf.String())
+}
+
+// Expand materializes c's events into concrete instances with start times
+// in [from, to). Non-recurring events are included if their start time
+// falls in the window; events with an RRule and/or RDate are expanded
+// into one instance per occurrence, minus any in ExDate. If another event
+// in c has the same UID and a RecurrenceID equal to a generated
+// occurrence's original start time, that event is substituted for the
+// occurrence.
+func (c *Calendar) Expand(from, to time.Time) []*Event {
+	// Instants are normalized to UTC before use as map keys: time.Time's
+	// == and map-key comparisons include the *Location pointer, and
+	// separate time.LoadLocation calls for the same zone name (as
+	// decodeEvent/decodeDateTime make for DTSTART, EXDATE, and
+	// RECURRENCE-ID) return different pointers, so same-instant values
+	// compare unequal unless normalized.
+	overrides := make(map[string]map[time.Time]*Event)
+	for _, e := range c.Event {
+		if e.RecurrenceID.IsZero() {
+			continue
+		}
+		m := overrides[e.UID]
+		if m == nil {
+			m = make(map[time.Time]*Event)
+			overrides[e.UID] = m
+		}
+		m[e.RecurrenceID.UTC()] = e
+	}
+
+	var out []*Event
+	for _, e := range c.Event {
+		if !e.RecurrenceID.IsZero() {
+			continue // substituted in via overrides, not a master event
+		}
+		if e.RRule == nil && len(e.RDate) == 0 {
+			if !e.Start.Before(from) && e.Start.Before(to) {
+				out = append(out, e)
+			}
+			continue
+		}
+		dur := e.End.Sub(e.Start)
+		// starts is keyed by UTC instant (see the note on overrides
+		// above), with the original zoned time as the value so
+		// generated instances keep DTSTART's time zone.
+		starts := make(map[time.Time]time.Time)
+		for _, t := range e.RRule.expand(e.Start, from, to) {
+			starts[t.UTC()] = t
+		}
+		for _, t := range e.RDate {
+			if !t.Before(from) && t.Before(to) {
+				starts[t.UTC()] = t
+			}
+		}
+		for _, t := range e.ExDate {
+			delete(starts, t.UTC())
+		}
+		for key, t := range starts {
+			if o, ok := overrides[e.UID][key]; ok {
+				out = append(out, o)
+				continue
+			}
+			inst := new(Event)
+			*inst = *e
+			inst.Start = t
+			inst.End = t.Add(dur)
+			inst.RRule = nil
+			inst.RDate = nil
+			inst.ExDate = nil
+			out = append(out, inst)
+		}
 	}
-	return p[0], p[1], nil
+	sort.Sort(eventList(out))
+	return out
 }
 
 type eventList []*Event
@@ -0,0 +1,72 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCalendarExpandTZID decodes a recurring VEVENT whose DTSTART, EXDATE,
+// and a RECURRENCE-ID override all carry the same TZID, decoded via
+// separate time.LoadLocation calls that return distinct *time.Location
+// pointers for the same zone. Expand must still exclude the EXDATE
+// instance and substitute the override by comparing instants, not by
+// time.Time map identity.
+func TestCalendarExpandTZID(t *testing.T) {
+	const src = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:daily@example.com\r\n" +
+		"DTSTART;TZID=America/New_York:20240101T090000\r\n" +
+		"DTEND;TZID=America/New_York:20240101T093000\r\n" +
+		"SUMMARY:Daily\r\n" +
+		"RRULE:FREQ=DAILY;COUNT=5\r\n" +
+		"EXDATE;TZID=America/New_York:20240103T090000\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:daily@example.com\r\n" +
+		"RECURRENCE-ID;TZID=America/New_York:20240104T090000\r\n" +
+		"DTSTART;TZID=America/New_York:20240104T100000\r\n" +
+		"DTEND;TZID=America/New_York:20240104T103000\r\n" +
+		"SUMMARY:Daily (moved)\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	c, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2024, 1, 10, 0, 0, 0, 0, loc)
+	got := c.Expand(from, to)
+
+	if len(got) != 4 {
+		t.Fatalf("Expand() returned %d events, want 4 (5 daily minus 1 excluded): %v", len(got), got)
+	}
+	for _, e := range got {
+		if e.Start.Hour() == 9 && e.Start.Day() == 3 {
+			t.Errorf("Expand() kept the instance excluded by EXDATE: %v", e.Start)
+		}
+	}
+	var moved *Event
+	for _, e := range got {
+		if e.Start.Day() == 4 {
+			moved = e
+		}
+	}
+	if moved == nil {
+		t.Fatalf("Expand() is missing the Jan 4 occurrence entirely: %v", got)
+	}
+	if moved.Summary != "Daily (moved)" || moved.Start.Hour() != 10 {
+		t.Errorf("Expand() didn't substitute the RECURRENCE-ID override: got %+v", moved)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// CalendarInfo holds the calendar-level properties that precede the first
+// component in a VCALENDAR.
+type CalendarInfo struct {
+	ProdID, Version, CalScale, Method string
+
+	// XWR holds non-standard X-WR-* extension properties (such as
+	// X-WR-CALNAME and X-WR-TIMEZONE), keyed by property name.
+	XWR map[string]string
+}
+
+// A Decoder reads a VCALENDAR one VEVENT at a time, so that large feeds
+// don't need to be held in memory all at once.
+type Decoder struct {
+	r     *bufio.Reader
+	info  CalendarInfo
+	ready bool
+	// pending is the value of a BEGIN line already read from r that
+	// Decode hasn't yet acted on, or "" if there is none.
+	pending string
+	done    bool
+
+	timezones []*Timezone
+	tzIndex   map[string]*Timezone
+	todos     []*Todo
+	journals  []*Journal
+	freebusys []*FreeBusy
+}
+
+// NewDecoder returns a Decoder that reads a VCALENDAR from rd.
+func NewDecoder(rd io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(rd)}
+}
+
+// ensureInfo reads up to and including the calendar-level properties,
+// stopping at the BEGIN of the first component, or at END:VCALENDAR if
+// there are no components.
+func (d *Decoder) ensureInfo() error {
+	if d.ready {
+		return nil
+	}
+	d.ready = true
+	p, err := decodeLine(d.r)
+	if err != nil {
+		return err
+	}
+	if p.Name != "BEGIN" || p.Value != "VCALENDAR" {
+		return errors.New("didn't find BEGIN:VCALENDAR")
+	}
+	for {
+		p, err := decodeLine(d.r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case p.Name == "BEGIN":
+			d.pending = p.Value
+			return nil
+		case p.Name == "END" && p.Value == "VCALENDAR":
+			d.done = true
+			return nil
+		case p.Name == "PRODID":
+			d.info.ProdID = p.Value
+		case p.Name == "VERSION":
+			d.info.Version = p.Value
+		case p.Name == "CALSCALE":
+			d.info.CalScale = p.Value
+		case p.Name == "METHOD":
+			d.info.Method = p.Value
+		case strings.HasPrefix(p.Name, "X-WR-"):
+			if d.info.XWR == nil {
+				d.info.XWR = make(map[string]string)
+			}
+			d.info.XWR[p.Name] = p.Value
+		}
+	}
+}
+
+// Info returns the calendar's PRODID, VERSION, CALSCALE, METHOD, and
+// X-WR-* properties. It may be called before or after Decode.
+func (d *Decoder) Info() (CalendarInfo, error) {
+	if err := d.ensureInfo(); err != nil {
+		return CalendarInfo{}, err
+	}
+	return d.info, nil
+}
+
+// Decode returns the next VEVENT in the calendar. It returns io.EOF once
+// END:VCALENDAR is reached. VTIMEZONE, VTODO, VJOURNAL, and VFREEBUSY
+// components are decoded and accumulated for retrieval via Timezones,
+// Todos, Journals, and FreeBusy, which reflect only what's been read so
+// far — call them after Decode returns io.EOF to get the complete sets.
+func (d *Decoder) Decode() (*Event, error) {
+	if err := d.ensureInfo(); err != nil {
+		return nil, err
+	}
+	if d.done {
+		return nil, io.EOF
+	}
+	name := d.pending
+	d.pending = ""
+	for {
+		if name == "" {
+			p, err := decodeLine(d.r)
+			if err != nil {
+				return nil, err
+			}
+			if p.Name == "END" && p.Value == "VCALENDAR" {
+				d.done = true
+				return nil, io.EOF
+			}
+			if p.Name == "BEGIN" {
+				name = p.Value
+			}
+			continue
+		}
+		switch name {
+		case "VEVENT":
+			return decodeEvent(d.r, d.lookupLocation)
+		case "VTIMEZONE":
+			tz, err := decodeTimezone(d.r)
+			if err != nil {
+				return nil, err
+			}
+			d.timezones = append(d.timezones, tz)
+			if tz.TZID != "" {
+				if d.tzIndex == nil {
+					d.tzIndex = make(map[string]*Timezone)
+				}
+				d.tzIndex[tz.TZID] = tz
+			}
+		case "VTODO":
+			t, err := decodeTodo(d.r, d.lookupLocation)
+			if err != nil {
+				return nil, err
+			}
+			d.todos = append(d.todos, t)
+		case "VJOURNAL":
+			j, err := decodeJournal(d.r, d.lookupLocation)
+			if err != nil {
+				return nil, err
+			}
+			d.journals = append(d.journals, j)
+		case "VFREEBUSY":
+			fb, err := decodeFreeBusy(d.r, d.lookupLocation)
+			if err != nil {
+				return nil, err
+			}
+			d.freebusys = append(d.freebusys, fb)
+		}
+		name = ""
+	}
+}
+
+// lookupLocation resolves tzid using the system's tzdata, falling back to
+// a fixed-offset zone synthesized from a VTIMEZONE component with a
+// matching TZID already read from the calendar.
+func (d *Decoder) lookupLocation(tzid string) (*time.Location, bool) {
+	if l, ok := systemTZLookup(tzid); ok {
+		return l, true
+	}
+	if tz := d.tzIndex[tzid]; tz != nil {
+		return tz.location(), true
+	}
+	return nil, false
+}
+
+// Timezones returns the VTIMEZONE components read so far.
+func (d *Decoder) Timezones() []*Timezone { return d.timezones }
+
+// Todos returns the VTODO components read so far.
+func (d *Decoder) Todos() []*Todo { return d.todos }
+
+// Journals returns the VJOURNAL components read so far.
+func (d *Decoder) Journals() []*Journal { return d.journals }
+
+// FreeBusy returns the VFREEBUSY components read so far.
+func (d *Decoder) FreeBusy() []*FreeBusy { return d.freebusys }
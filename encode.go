@@ -0,0 +1,525 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLineOctets is the maximum length of a content line before it must be
+// folded, per RFC 5545 section 3.1.
+const maxLineOctets = 75
+
+// Encode writes c to w in RFC 5545 wire format.
+func Encode(w io.Writer, c *Calendar) error {
+	return NewEncoder(w).Encode(c)
+}
+
+// An Encoder writes a Calendar in RFC 5545 wire format.
+type Encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewEncoder returns an Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes c and flushes the underlying writer.
+func (enc *Encoder) Encode(c *Calendar) error {
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VCALENDAR"})
+	version := c.Info.Version
+	if version == "" {
+		version = "2.0"
+	}
+	enc.writeProperty(Property{Name: "VERSION", Value: version})
+	if c.Info.ProdID != "" {
+		enc.writeProperty(Property{Name: "PRODID", Value: c.Info.ProdID})
+	}
+	if c.Info.CalScale != "" {
+		enc.writeProperty(Property{Name: "CALSCALE", Value: c.Info.CalScale})
+	}
+	if c.Info.Method != "" {
+		enc.writeProperty(Property{Name: "METHOD", Value: c.Info.Method})
+	}
+	xwrNames := make([]string, 0, len(c.Info.XWR))
+	for name := range c.Info.XWR {
+		xwrNames = append(xwrNames, name)
+	}
+	sort.Strings(xwrNames)
+	for _, name := range xwrNames {
+		enc.writeProperty(Property{Name: name, Value: c.Info.XWR[name]})
+	}
+
+	for _, tzid := range timezonesUsed(c) {
+		enc.writeTimezone(tzid)
+	}
+	for _, e := range c.Event {
+		enc.writeEvent(e)
+	}
+	for _, t := range c.Todo {
+		enc.writeTodo(t)
+	}
+	for _, j := range c.Journal {
+		enc.writeJournal(j)
+	}
+	for _, fb := range c.FreeBusy {
+		enc.writeFreeBusy(fb)
+	}
+	enc.writeProperty(Property{Name: "END", Value: "VCALENDAR"})
+	if enc.err != nil {
+		return enc.err
+	}
+	return enc.w.Flush()
+}
+
+func (enc *Encoder) writeEvent(e *Event) {
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VEVENT"})
+	if e.UID != "" {
+		enc.writeProperty(Property{Name: "UID", Value: e.UID})
+	}
+	if !e.RecurrenceID.IsZero() {
+		enc.writeProperty(dateTimeProperty("RECURRENCE-ID", e.RecurrenceID))
+	}
+	if !e.Start.IsZero() {
+		enc.writeProperty(dateTimeProperty("DTSTART", e.Start))
+	}
+	if !e.End.IsZero() {
+		enc.writeProperty(dateTimeProperty("DTEND", e.End))
+	}
+	if e.Summary != "" {
+		enc.writeProperty(Property{Name: "SUMMARY", Value: escapeText(e.Summary)})
+	}
+	if e.Location != "" {
+		enc.writeProperty(Property{Name: "LOCATION", Value: escapeText(e.Location)})
+	}
+	if e.Description != "" {
+		enc.writeProperty(Property{Name: "DESCRIPTION", Value: escapeText(e.Description)})
+	}
+	if e.RRule != nil {
+		enc.writeProperty(Property{Name: "RRULE", Value: encodeRecurrenceRule(e.RRule)})
+	}
+	if len(e.RDate) > 0 {
+		enc.writeProperty(dateTimeListProperty("RDATE", e.RDate))
+	}
+	if len(e.ExDate) > 0 {
+		enc.writeProperty(dateTimeListProperty("EXDATE", e.ExDate))
+	}
+	for _, p := range e.Raw {
+		enc.writeProperty(p)
+	}
+	for _, a := range e.Alarm {
+		enc.writeAlarm(a)
+	}
+	enc.writeProperty(Property{Name: "END", Value: "VEVENT"})
+}
+
+func (enc *Encoder) writeTodo(t *Todo) {
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VTODO"})
+	if t.UID != "" {
+		enc.writeProperty(Property{Name: "UID", Value: t.UID})
+	}
+	if !t.Start.IsZero() {
+		enc.writeProperty(dateTimeProperty("DTSTART", t.Start))
+	}
+	if !t.Due.IsZero() {
+		enc.writeProperty(dateTimeProperty("DUE", t.Due))
+	}
+	if !t.Completed.IsZero() {
+		enc.writeProperty(dateTimeProperty("COMPLETED", t.Completed))
+	}
+	if t.Summary != "" {
+		enc.writeProperty(Property{Name: "SUMMARY", Value: escapeText(t.Summary)})
+	}
+	if t.Location != "" {
+		enc.writeProperty(Property{Name: "LOCATION", Value: escapeText(t.Location)})
+	}
+	if t.Description != "" {
+		enc.writeProperty(Property{Name: "DESCRIPTION", Value: escapeText(t.Description)})
+	}
+	if t.Status != "" {
+		enc.writeProperty(Property{Name: "STATUS", Value: t.Status})
+	}
+	if t.PercentComplete != 0 {
+		enc.writeProperty(Property{Name: "PERCENT-COMPLETE", Value: strconv.Itoa(t.PercentComplete)})
+	}
+	for _, p := range t.Raw {
+		enc.writeProperty(p)
+	}
+	for _, a := range t.Alarm {
+		enc.writeAlarm(a)
+	}
+	enc.writeProperty(Property{Name: "END", Value: "VTODO"})
+}
+
+func (enc *Encoder) writeJournal(j *Journal) {
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VJOURNAL"})
+	if j.UID != "" {
+		enc.writeProperty(Property{Name: "UID", Value: j.UID})
+	}
+	if !j.Start.IsZero() {
+		enc.writeProperty(dateTimeProperty("DTSTART", j.Start))
+	}
+	if j.Summary != "" {
+		enc.writeProperty(Property{Name: "SUMMARY", Value: escapeText(j.Summary)})
+	}
+	if j.Description != "" {
+		enc.writeProperty(Property{Name: "DESCRIPTION", Value: escapeText(j.Description)})
+	}
+	for _, p := range j.Raw {
+		enc.writeProperty(p)
+	}
+	enc.writeProperty(Property{Name: "END", Value: "VJOURNAL"})
+}
+
+func (enc *Encoder) writeFreeBusy(fb *FreeBusy) {
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VFREEBUSY"})
+	if fb.UID != "" {
+		enc.writeProperty(Property{Name: "UID", Value: fb.UID})
+	}
+	if !fb.Start.IsZero() {
+		enc.writeProperty(dateTimeProperty("DTSTART", fb.Start))
+	}
+	if !fb.End.IsZero() {
+		enc.writeProperty(dateTimeProperty("DTEND", fb.End))
+	}
+	if len(fb.Busy) > 0 {
+		enc.writeProperty(freeBusyProperty(fb.Busy))
+	}
+	for _, p := range fb.Raw {
+		enc.writeProperty(p)
+	}
+	enc.writeProperty(Property{Name: "END", Value: "VFREEBUSY"})
+}
+
+// freeBusyProperty formats periods as a FREEBUSY property value, a
+// comma-separated list of "start/end" period values.
+func freeBusyProperty(periods []Period) Property {
+	p := dateTimeProperty("FREEBUSY", periods[0].Start)
+	values := make([]string, len(periods))
+	for i, period := range periods {
+		start := dateTimeProperty("FREEBUSY", period.Start).Value
+		end := dateTimeProperty("FREEBUSY", period.End).Value
+		values[i] = start + "/" + end
+	}
+	p.Value = strings.Join(values, ",")
+	return p
+}
+
+// writeAlarm emits a VALARM sub-component for a.
+func (enc *Encoder) writeAlarm(a Alarm) {
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VALARM"})
+	if a.Action != "" {
+		enc.writeProperty(Property{Name: "ACTION", Value: a.Action})
+	}
+	enc.writeProperty(alarmTriggerProperty(a.Trigger))
+	if a.Summary != "" {
+		enc.writeProperty(Property{Name: "SUMMARY", Value: escapeText(a.Summary)})
+	}
+	if a.Description != "" {
+		enc.writeProperty(Property{Name: "DESCRIPTION", Value: escapeText(a.Description)})
+	}
+	for _, attendee := range a.Attendee {
+		enc.writeProperty(Property{Name: "ATTENDEE", Value: attendee})
+	}
+	if a.Repeat != 0 {
+		enc.writeProperty(Property{Name: "REPEAT", Value: strconv.Itoa(a.Repeat)})
+	}
+	for _, p := range a.Raw {
+		enc.writeProperty(p)
+	}
+	enc.writeProperty(Property{Name: "END", Value: "VALARM"})
+}
+
+// alarmTriggerProperty formats t as a TRIGGER property, either an absolute
+// DATE-TIME or a duration relative to the owning component's start (or
+// end, if RelatedEnd).
+func alarmTriggerProperty(t AlarmTrigger) Property {
+	if !t.Absolute.IsZero() {
+		p := dateTimeProperty("TRIGGER", t.Absolute)
+		if p.Params == nil {
+			p.Params = make(map[string][]string)
+		}
+		p.Params["VALUE"] = []string{"DATE-TIME"}
+		return p
+	}
+	p := Property{Name: "TRIGGER", Value: formatDuration(t.Duration)}
+	if t.RelatedEnd {
+		p.Params = map[string][]string{"RELATED": {"END"}}
+	}
+	return p
+}
+
+// formatDuration formats d as an RFC 5545 dur-value, e.g. "-PT15M".
+func formatDuration(d time.Duration) string {
+	neg := d < 0
+	if neg {
+		d = -d
+	}
+	var sb strings.Builder
+	sb.WriteByte('P')
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	if days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+	}
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	if hours > 0 || minutes > 0 || seconds > 0 || days == 0 {
+		sb.WriteByte('T')
+		if hours > 0 {
+			fmt.Fprintf(&sb, "%dH", hours)
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&sb, "%dM", minutes)
+		}
+		if seconds > 0 || (hours == 0 && minutes == 0) {
+			fmt.Fprintf(&sb, "%dS", seconds)
+		}
+	}
+	s := sb.String()
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// dateTimeProperty formats t as a DATE-TIME property value, adding a TZID
+// parameter for zoned times and a trailing "Z" for UTC times.
+func dateTimeProperty(name string, t time.Time) Property {
+	const layout = "20060102T150405"
+	if t.Location() == time.UTC {
+		return Property{Name: name, Value: t.Format(layout) + "Z"}
+	}
+	p := Property{Name: name, Value: t.Format(layout)}
+	if zone := t.Location().String(); zone != "" && zone != "Local" {
+		p.Params = map[string][]string{"TZID": {zone}}
+	}
+	return p
+}
+
+func dateTimeListProperty(name string, ts []time.Time) Property {
+	p := dateTimeProperty(name, ts[0])
+	values := make([]string, len(ts))
+	for i, t := range ts {
+		values[i] = dateTimeProperty(name, t).Value
+	}
+	p.Value = strings.Join(values, ",")
+	return p
+}
+
+var weekdayCodes = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func encodeRecurrenceRule(r *RecurrenceRule) string {
+	var parts []string
+	switch r.Freq {
+	case Daily:
+		parts = append(parts, "FREQ=DAILY")
+	case Weekly:
+		parts = append(parts, "FREQ=WEEKLY")
+	case Monthly:
+		parts = append(parts, "FREQ=MONTHLY")
+	case Yearly:
+		parts = append(parts, "FREQ=YEARLY")
+	}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			s := weekdayCodes[wd.Day]
+			if wd.N != 0 {
+				s = fmt.Sprintf("%d%s", wd.N, s)
+			}
+			days[i] = s
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.WkSt != time.Monday {
+		parts = append(parts, "WKST="+weekdayCodes[r.WkSt])
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinInts(ns []int) string {
+	ss := make([]string, len(ns))
+	for i, n := range ns {
+		ss[i] = strconv.Itoa(n)
+	}
+	return strings.Join(ss, ",")
+}
+
+// timezonesUsed returns the sorted, deduplicated names of all non-UTC,
+// non-floating zones referenced by c's events, todos, journals, and
+// free/busy components.
+func timezonesUsed(c *Calendar) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(t time.Time) {
+		if t.IsZero() || t.Location() == time.UTC {
+			return
+		}
+		name := t.Location().String()
+		if name == "" || name == "Local" || seen[name] {
+			return
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	for _, e := range c.Event {
+		add(e.Start)
+		add(e.End)
+		add(e.RecurrenceID)
+		for _, t := range e.RDate {
+			add(t)
+		}
+		for _, t := range e.ExDate {
+			add(t)
+		}
+	}
+	for _, t := range c.Todo {
+		add(t.Start)
+		add(t.Due)
+		add(t.Completed)
+	}
+	for _, j := range c.Journal {
+		add(j.Start)
+	}
+	for _, fb := range c.FreeBusy {
+		add(fb.Start)
+		add(fb.End)
+		for _, period := range fb.Busy {
+			add(period.Start)
+			add(period.End)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeTimezone emits a VTIMEZONE block for tzid using the UTC offset
+// tzid has on January 1, 2000. It doesn't reconstruct historical DST
+// transition rules; readers that need those should fall back to their own
+// tzdata for tzid. Nothing is written if tzid isn't in the system's tzdata.
+func (enc *Encoder) writeTimezone(tzid string) {
+	loc, err := time.LoadLocation(tzid)
+	if err != nil {
+		return
+	}
+	_, offset := time.Date(2000, 1, 1, 0, 0, 0, 0, loc).Zone()
+	off := formatOffset(offset)
+	enc.writeProperty(Property{Name: "BEGIN", Value: "VTIMEZONE"})
+	enc.writeProperty(Property{Name: "TZID", Value: tzid})
+	enc.writeProperty(Property{Name: "BEGIN", Value: "STANDARD"})
+	enc.writeProperty(Property{Name: "DTSTART", Value: "19700101T000000"})
+	enc.writeProperty(Property{Name: "TZOFFSETFROM", Value: off})
+	enc.writeProperty(Property{Name: "TZOFFSETTO", Value: off})
+	enc.writeProperty(Property{Name: "END", Value: "STANDARD"})
+	enc.writeProperty(Property{Name: "END", Value: "VTIMEZONE"})
+}
+
+func formatOffset(sec int) string {
+	sign := "+"
+	if sec < 0 {
+		sign, sec = "-", -sec
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, sec/3600, (sec%3600)/60)
+}
+
+func (enc *Encoder) writeProperty(p Property) {
+	if enc.err != nil {
+		return
+	}
+	enc.err = writeFolded(enc.w, propertyLine(p))
+}
+
+// propertyLine renders p as an unfolded RFC 5545 content line.
+func propertyLine(p Property) string {
+	var sb strings.Builder
+	sb.WriteString(p.Name)
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteByte(';')
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		for i, v := range p.Params[name] {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			if strings.ContainsAny(v, ":;,") {
+				sb.WriteByte('"')
+				sb.WriteString(v)
+				sb.WriteByte('"')
+			} else {
+				sb.WriteString(v)
+			}
+		}
+	}
+	sb.WriteByte(':')
+	sb.WriteString(p.Value)
+	return sb.String()
+}
+
+// writeFolded writes line to w, folded at maxLineOctets octets per RFC
+// 5545 section 3.1, terminated with CRLF.
+func writeFolded(w *bufio.Writer, line string) error {
+	b := []byte(line)
+	first := true
+	for len(b) > 0 {
+		max := maxLineOctets
+		if !first {
+			max-- // leading continuation space counts toward the limit
+		}
+		n := max
+		if n >= len(b) {
+			n = len(b)
+		} else {
+			for n > 0 && b[n]&0xC0 == 0x80 { // don't split a UTF-8 rune
+				n--
+			}
+		}
+		if !first {
+			if _, err := w.WriteString(" "); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(b[:n]); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+		b = b[n:]
+		first = false
+	}
+	return nil
+}
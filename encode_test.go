@@ -0,0 +1,143 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestWriteFolded(t *testing.T) {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	line := "SUMMARY:" + strings.Repeat("x", 100)
+	if err := writeFolded(w, line); err != nil {
+		t.Fatalf("writeFolded: %v", err)
+	}
+	w.Flush()
+	got := sb.String()
+	lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), got)
+	}
+	if len(lines[0]) != 75 {
+		t.Errorf("first line is %d octets, want 75", len(lines[0]))
+	}
+	if !strings.HasPrefix(lines[1], " ") {
+		t.Errorf("continuation line doesn't start with a space: %q", lines[1])
+	}
+	if strings.Join(strings.Split(got, "\r\n "), "") != "SUMMARY:"+strings.Repeat("x", 100)+"\r\n" {
+		t.Errorf("unfolding the output doesn't reproduce the original line: %q", got)
+	}
+}
+
+func TestPropertyLine(t *testing.T) {
+	tests := []struct {
+		p    Property
+		want string
+	}{
+		{
+			p:    Property{Name: "UID", Value: "1@example.com"},
+			want: "UID:1@example.com",
+		},
+		{
+			p: Property{
+				Name:   "DTSTART",
+				Params: map[string][]string{"TZID": {"America/New_York"}},
+				Value:  "20240101T090000",
+			},
+			want: "DTSTART;TZID=America/New_York:20240101T090000",
+		},
+		{
+			p: Property{
+				Name:   "ATTACH",
+				Params: map[string][]string{"FMTTYPE": {"a:b"}},
+				Value:  "http://example.com/a:b",
+			},
+			want: `ATTACH;FMTTYPE="a:b":http://example.com/a:b`,
+		},
+	}
+	for _, tt := range tests {
+		if got := propertyLine(tt.p); got != tt.want {
+			t.Errorf("propertyLine(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeTextRoundTrip(t *testing.T) {
+	const raw = "a, b; c\\d\ne"
+	var sb strings.Builder
+	enc := NewEncoder(&sb)
+	enc.writeProperty(Property{Name: "SUMMARY", Value: escapeText(raw)})
+	enc.w.Flush()
+	p, err := parseContentLine(strings.TrimSuffix(sb.String(), "\r\n"))
+	if err != nil {
+		t.Fatalf("parseContentLine: %v", err)
+	}
+	if got := unescapeText(p.Value); got != raw {
+		t.Errorf("round-tripped text = %q, want %q", got, raw)
+	}
+}
+
+// TestEncodeRoundTrip decodes a calendar with a VALARM, a VTODO, and a
+// VJOURNAL and re-encodes it, checking that none of them are dropped.
+func TestEncodeRoundTrip(t *testing.T) {
+	const src = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:event-1@example.com\r\n" +
+		"DTSTART:20240101T090000Z\r\n" +
+		"SUMMARY:Event\r\n" +
+		"BEGIN:VALARM\r\n" +
+		"ACTION:DISPLAY\r\n" +
+		"TRIGGER:-PT15M\r\n" +
+		"END:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"UID:todo-1@example.com\r\n" +
+		"DTSTART:20240102T090000Z\r\n" +
+		"SUMMARY:Todo\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VJOURNAL\r\n" +
+		"UID:journal-1@example.com\r\n" +
+		"DTSTART:20240103T090000Z\r\n" +
+		"SUMMARY:Journal\r\n" +
+		"END:VJOURNAL\r\n" +
+		"BEGIN:VFREEBUSY\r\n" +
+		"UID:fb-1@example.com\r\n" +
+		"DTSTART:20240104T090000Z\r\n" +
+		"DTEND:20240105T090000Z\r\n" +
+		"END:VFREEBUSY\r\n" +
+		"END:VCALENDAR\r\n"
+
+	c, err := Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := Encode(&sb, c); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	c2, err := Decode(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Decode of re-encoded calendar: %v\n%s", err, sb.String())
+	}
+
+	if len(c2.Event) != 1 || len(c2.Event[0].Alarm) != 1 {
+		t.Errorf("re-encoded calendar lost the event's VALARM: %+v", c2.Event)
+	}
+	if len(c2.Todo) != 1 {
+		t.Errorf("re-encoded calendar lost the VTODO: %+v", c2.Todo)
+	}
+	if len(c2.Journal) != 1 {
+		t.Errorf("re-encoded calendar lost the VJOURNAL: %+v", c2.Journal)
+	}
+	if len(c2.FreeBusy) != 1 {
+		t.Errorf("re-encoded calendar lost the VFREEBUSY: %+v", c2.FreeBusy)
+	}
+}
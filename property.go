@@ -0,0 +1,166 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Property is a single RFC 5545 content line, decomposed into its name,
+// parameters, and value. For example,
+//
+//	DTSTART;TZID=America/New_York;VALUE=DATE-TIME:20240101T090000
+//
+// decodes to Property{Name: "DTSTART", Params: {"TZID": {"America/New_York"}, "VALUE": {"DATE-TIME"}}, Value: "20240101T090000"}.
+type Property struct {
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// parseContentLine parses a single unfolded RFC 5545 content line.
+func parseContentLine(s string) (Property, error) {
+	i := strings.IndexAny(s, ";:")
+	if i < 0 {
+		return Property{}, errors.New("ics: bad line, couldn't find name")
+	}
+	p := Property{Name: s[:i]}
+	rest := s[i:]
+	for len(rest) > 0 && rest[0] == ';' {
+		rest = rest[1:]
+		j := strings.IndexByte(rest, '=')
+		if j < 0 {
+			return Property{}, errors.New("ics: bad parameter, missing '='")
+		}
+		name := rest[:j]
+		rest = rest[j+1:]
+		var vals []string
+		for {
+			var val string
+			if len(rest) > 0 && rest[0] == '"' {
+				k := strings.IndexByte(rest[1:], '"')
+				if k < 0 {
+					return Property{}, errors.New("ics: unterminated quoted parameter value")
+				}
+				val, rest = rest[1:1+k], rest[1+k+1:]
+			} else {
+				k := strings.IndexAny(rest, ",;:")
+				if k < 0 {
+					k = len(rest)
+				}
+				val, rest = rest[:k], rest[k:]
+			}
+			vals = append(vals, val)
+			if len(rest) > 0 && rest[0] == ',' {
+				rest = rest[1:]
+				continue
+			}
+			break
+		}
+		if p.Params == nil {
+			p.Params = make(map[string][]string)
+		}
+		p.Params[name] = vals
+	}
+	if len(rest) == 0 || rest[0] != ':' {
+		return Property{}, errors.New("ics: bad line, couldn't find value")
+	}
+	p.Value = rest[1:]
+	return p, nil
+}
+
+// decodeDateTime decodes a DATE or DATE-TIME property value, honoring its
+// VALUE and TZID parameters. A trailing "Z" on the value means UTC; a
+// TZID names the zone to interpret a floating value in, resolved by
+// calling lookupTZ (or, if lookupTZ is nil, the system's tzdata); with
+// neither, the value is floating and is decoded in time.Local. If the
+// TZID can't be resolved, decodeDateTime falls back to treating the
+// value as floating.
+func decodeDateTime(p Property, lookupTZ func(string) (*time.Location, bool)) (time.Time, error) {
+	if lookupTZ == nil {
+		lookupTZ = systemTZLookup
+	}
+	layout := "20060102T150405"
+	if vs := p.Params["VALUE"]; len(vs) > 0 && vs[0] == "DATE" {
+		layout = "20060102"
+	}
+	value := p.Value
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(layout+"Z", value)
+	}
+	loc := time.Local
+	if tzids := p.Params["TZID"]; len(tzids) > 0 {
+		if l, ok := lookupTZ(tzids[0]); ok {
+			loc = l
+		}
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// systemTZLookup resolves a TZID using the system's tzdata.
+func systemTZLookup(tzid string) (*time.Location, bool) {
+	l, err := time.LoadLocation(tzid)
+	return l, err == nil
+}
+
+// escapeText escapes a TEXT value's backslashes, semicolons, commas, and
+// newlines per RFC 5545 section 3.3.11.
+func escapeText(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case ';':
+			sb.WriteString(`\;`)
+		case ',':
+			sb.WriteString(`\,`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// unescapeText reverses escapeText.
+func unescapeText(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				sb.WriteByte('\n')
+			} else {
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// decodeDateTimeList decodes a comma-separated list of DATE or DATE-TIME
+// values, as used by the RDATE and EXDATE properties. All values in the
+// list share the property's parameters.
+func decodeDateTimeList(p Property, lookupTZ func(string) (*time.Location, bool)) ([]time.Time, error) {
+	parts := strings.Split(p.Value, ",")
+	ts := make([]time.Time, len(parts))
+	for i, v := range parts {
+		t, err := decodeDateTime(Property{Name: p.Name, Params: p.Params, Value: v}, lookupTZ)
+		if err != nil {
+			return nil, err
+		}
+		ts[i] = t
+	}
+	return ts, nil
+}
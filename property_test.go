@@ -0,0 +1,111 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseContentLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Property
+	}{
+		{
+			line: "UID:1@example.com",
+			want: Property{Name: "UID", Value: "1@example.com"},
+		},
+		{
+			line: "DTSTART;TZID=America/New_York;VALUE=DATE-TIME:20240101T090000",
+			want: Property{
+				Name:   "DTSTART",
+				Params: map[string][]string{"TZID": {"America/New_York"}, "VALUE": {"DATE-TIME"}},
+				Value:  "20240101T090000",
+			},
+		},
+		{
+			// A quoted parameter value may itself contain a colon.
+			line: `ATTACH;FMTTYPE="a:b":http://example.com/a:b`,
+			want: Property{
+				Name:   "ATTACH",
+				Params: map[string][]string{"FMTTYPE": {"a:b"}},
+				Value:  "http://example.com/a:b",
+			},
+		},
+		{
+			line: "EXDATE;VALUE=DATE:20240101,20240201",
+			want: Property{
+				Name:   "EXDATE",
+				Params: map[string][]string{"VALUE": {"DATE"}},
+				Value:  "20240101,20240201",
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseContentLine(tt.line)
+		if err != nil {
+			t.Errorf("parseContentLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseContentLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseContentLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"NOVALUEHERE",
+		"FOO;BAR:baz",           // parameter missing '='
+		`FOO;BAR="unterminated`, // unterminated quoted value
+	} {
+		if _, err := parseContentLine(line); err == nil {
+			t.Errorf("parseContentLine(%q): got nil error, want one", line)
+		}
+	}
+}
+
+func TestEscapeUnescapeText(t *testing.T) {
+	tests := []struct{ raw, escaped string }{
+		{"plain text", "plain text"},
+		{"a, b; c\\d\ne", `a\, b\; c\\d\ne`},
+	}
+	for _, tt := range tests {
+		if got := escapeText(tt.raw); got != tt.escaped {
+			t.Errorf("escapeText(%q) = %q, want %q", tt.raw, got, tt.escaped)
+		}
+		if got := unescapeText(tt.escaped); got != tt.raw {
+			t.Errorf("unescapeText(%q) = %q, want %q", tt.escaped, got, tt.raw)
+		}
+	}
+}
+
+func TestDecodeDateTime(t *testing.T) {
+	tests := []struct {
+		p    Property
+		want time.Time
+	}{
+		{
+			p:    Property{Value: "20240101T090000Z"},
+			want: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			p:    Property{Params: map[string][]string{"VALUE": {"DATE"}}, Value: "20240101"},
+			want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local),
+		},
+	}
+	for _, tt := range tests {
+		got, err := decodeDateTime(tt.p, nil)
+		if err != nil {
+			t.Errorf("decodeDateTime(%+v): %v", tt.p, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("decodeDateTime(%+v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
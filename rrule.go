@@ -0,0 +1,326 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ part of an RRULE.
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+// Weekday is a BYDAY entry, optionally ordinal (e.g. "2MO" is the second
+// Monday, "-1FR" is the last Friday). N is zero when no ordinal was given.
+type Weekday struct {
+	N   int
+	Day time.Weekday
+}
+
+// RecurrenceRule is a parsed RFC 5545 RRULE value.
+type RecurrenceRule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []Weekday
+	ByMonthDay []int
+	ByMonth    []int
+	WkSt       time.Weekday
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseWeekday(s string) (Weekday, error) {
+	i := 0
+	for i < len(s) && (s[i] == '+' || s[i] == '-' || (s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+	var n int
+	if i > 0 {
+		v, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return Weekday{}, err
+		}
+		n = v
+	}
+	day, ok := weekdayNames[s[i:]]
+	if !ok {
+		return Weekday{}, fmt.Errorf("ics: bad BYDAY value %q", s)
+	}
+	return Weekday{N: n, Day: day}, nil
+}
+
+// parseRecurrenceRule parses the value of an RRULE property, e.g.
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10".
+func parseRecurrenceRule(s string) (*RecurrenceRule, error) {
+	r := &RecurrenceRule{Interval: 1, WkSt: time.Monday}
+	sawFreq := false
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("ics: bad RRULE part %q", part)
+		}
+		name, val := kv[0], kv[1]
+		switch name {
+		case "FREQ":
+			switch val {
+			case "DAILY":
+				r.Freq = Daily
+			case "WEEKLY":
+				r.Freq = Weekly
+			case "MONTHLY":
+				r.Freq = Monthly
+			case "YEARLY":
+				r.Freq = Yearly
+			default:
+				return nil, fmt.Errorf("ics: unsupported RRULE FREQ %q", val)
+			}
+			sawFreq = true
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, err
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, err
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := decodeTime(val)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				wd, err := parseWeekday(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, d := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByMonth = append(r.ByMonth, n)
+			}
+		case "WKST":
+			wd, err := parseWeekday(val)
+			if err != nil {
+				return nil, err
+			}
+			r.WkSt = wd.Day
+		}
+	}
+	if !sawFreq {
+		return nil, fmt.Errorf("ics: RRULE missing FREQ: %q", s)
+	}
+	if r.Interval <= 0 {
+		r.Interval = 1
+	}
+	return r, nil
+}
+
+// maxRecurrenceIterations bounds the number of FREQ periods expand will
+// walk, so a rule with neither COUNT nor UNTIL can't loop forever.
+const maxRecurrenceIterations = 100000
+
+// expand generates the occurrences of r starting at dtstart whose start
+// time falls in [from, to).
+func (r *RecurrenceRule) expand(dtstart, from, to time.Time) []time.Time {
+	if r == nil {
+		return nil
+	}
+	var out []time.Time
+	base := dtstart
+	n := 0
+	for iter := 0; iter < maxRecurrenceIterations; iter++ {
+		done := false
+		for _, t := range r.instancesFor(base, dtstart) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				done = true
+				break
+			}
+			if r.Count > 0 && n >= r.Count {
+				done = true
+				break
+			}
+			n++
+			if !t.Before(from) && t.Before(to) {
+				out = append(out, t)
+			}
+		}
+		if done {
+			break
+		}
+		if r.Count == 0 && r.Until.IsZero() && base.After(to) {
+			break
+		}
+		switch r.Freq {
+		case Daily:
+			base = base.AddDate(0, 0, r.Interval)
+		case Weekly:
+			base = base.AddDate(0, 0, 7*r.Interval)
+		case Monthly:
+			base = base.AddDate(0, r.Interval, 0)
+		case Yearly:
+			base = base.AddDate(r.Interval, 0, 0)
+		}
+	}
+	return out
+}
+
+// instancesFor returns the candidate occurrences within the FREQ period
+// anchored at base, with the time-of-day taken from dtstart. BYDAY is
+// applied to WEEKLY, MONTHLY, and YEARLY rules, BYMONTHDAY to MONTHLY and
+// YEARLY rules, and BYMONTH to YEARLY rules only; other combinations
+// ignore those parts. When both BYMONTHDAY and BYDAY are given, only
+// BYMONTHDAY is used. A YEARLY rule without BYMONTH uses base's month.
+func (r *RecurrenceRule) instancesFor(base, dtstart time.Time) []time.Time {
+	loc := dtstart.Location()
+	var out []time.Time
+	switch r.Freq {
+	case Daily:
+		out = []time.Time{atClock(base, dtstart)}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			out = []time.Time{atClock(base, dtstart)}
+			break
+		}
+		start := startOfWeek(base, r.WkSt)
+		for _, wd := range r.ByDay {
+			offset := (int(wd.Day) - int(r.WkSt) + 7) % 7
+			out = append(out, atClock(start.AddDate(0, 0, offset), dtstart))
+		}
+	case Monthly:
+		year, month, _ := base.Date()
+		switch {
+		case len(r.ByMonthDay) > 0:
+			for _, d := range r.ByMonthDay {
+				if t, ok := monthDay(year, month, d, loc); ok {
+					out = append(out, atClock(t, dtstart))
+				}
+			}
+		case len(r.ByDay) > 0:
+			for _, wd := range r.ByDay {
+				if t, ok := nthWeekdayOfMonth(year, month, wd, loc); ok {
+					out = append(out, atClock(t, dtstart))
+				}
+			}
+		default:
+			if t, ok := monthDay(year, month, dtstart.Day(), loc); ok {
+				out = append(out, atClock(t, dtstart))
+			}
+		}
+	case Yearly:
+		year := base.Year()
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []int{int(base.Month())}
+		}
+		for _, m := range months {
+			month := time.Month(m)
+			switch {
+			case len(r.ByMonthDay) > 0:
+				for _, d := range r.ByMonthDay {
+					if t, ok := monthDay(year, month, d, loc); ok {
+						out = append(out, atClock(t, dtstart))
+					}
+				}
+			case len(r.ByDay) > 0:
+				for _, wd := range r.ByDay {
+					if t, ok := nthWeekdayOfMonth(year, month, wd, loc); ok {
+						out = append(out, atClock(t, dtstart))
+					}
+				}
+			default:
+				if t, ok := monthDay(year, month, dtstart.Day(), loc); ok {
+					out = append(out, atClock(t, dtstart))
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// atClock returns the date of t with the hour/minute/second of clock.
+func atClock(t, clock time.Time) time.Time {
+	y, m, d := t.Date()
+	h, mi, s := clock.Clock()
+	return time.Date(y, m, d, h, mi, s, 0, clock.Location())
+}
+
+func startOfWeek(t time.Time, wkst time.Weekday) time.Time {
+	offset := (int(t.Weekday()) - int(wkst) + 7) % 7
+	return t.AddDate(0, 0, -offset)
+}
+
+// monthDay returns the day-th day of month (counting back from the end of
+// the month when day is negative), or ok=false if it doesn't exist.
+func monthDay(year int, month time.Month, day int, loc *time.Location) (t time.Time, ok bool) {
+	if day > 0 {
+		t = time.Date(year, month, day, 0, 0, 0, 0, loc)
+	} else if day < 0 {
+		last := time.Date(year, month+1, 1, 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+		t = last.AddDate(0, 0, day+1)
+	} else {
+		return time.Time{}, false
+	}
+	return t, t.Month() == month
+}
+
+// nthWeekdayOfMonth returns the N-th occurrence of wd.Day in month
+// (counting back from the end of the month when wd.N is negative).
+func nthWeekdayOfMonth(year int, month time.Month, wd Weekday, loc *time.Location) (t time.Time, ok bool) {
+	n := wd.N
+	if n == 0 {
+		n = 1
+	}
+	if n > 0 {
+		first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		offset := (int(wd.Day) - int(first.Weekday()) + 7) % 7
+		t = time.Date(year, month, 1+offset+7*(n-1), 0, 0, 0, 0, loc)
+	} else {
+		last := time.Date(year, month+1, 1, 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+		offset := (int(last.Weekday()) - int(wd.Day) + 7) % 7
+		t = time.Date(year, month, last.Day()-offset+7*(n+1), 0, 0, 0, 0, loc)
+	}
+	return t, t.Month() == month
+}
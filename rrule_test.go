@@ -0,0 +1,122 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ics
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseRecurrenceRule(t *testing.T, s string) *RecurrenceRule {
+	r, err := parseRecurrenceRule(s)
+	if err != nil {
+		t.Fatalf("parseRecurrenceRule(%q): %v", s, err)
+	}
+	return r
+}
+
+func dateUTC(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+}
+
+func TestRecurrenceRuleExpand(t *testing.T) {
+	window := func(from, to time.Time) (time.Time, time.Time) { return from, to }
+	from, to := window(dateUTC(2024, 1, 1), dateUTC(2025, 1, 1))
+
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		want    []time.Time
+	}{
+		{
+			name:    "daily count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: dateUTC(2024, 1, 1),
+			want:    []time.Time{dateUTC(2024, 1, 1), dateUTC(2024, 1, 2), dateUTC(2024, 1, 3)},
+		},
+		{
+			name:    "weekly byday",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			dtstart: dateUTC(2024, 1, 1), // a Monday
+			want:    []time.Time{dateUTC(2024, 1, 1), dateUTC(2024, 1, 3), dateUTC(2024, 1, 8), dateUTC(2024, 1, 10)},
+		},
+		{
+			name:    "monthly on day 31 rolls forward to months that have a 31st, never into the next month",
+			rule:    "FREQ=MONTHLY;COUNT=4",
+			dtstart: dateUTC(2024, 1, 31),
+			want:    []time.Time{dateUTC(2024, 1, 31), dateUTC(2024, 3, 31), dateUTC(2024, 5, 31), dateUTC(2024, 7, 31)},
+		},
+		{
+			name:    "monthly bymonthday negative (from end of month)",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			dtstart: dateUTC(2024, 1, 15),
+			want:    []time.Time{dateUTC(2024, 1, 31), dateUTC(2024, 2, 29), dateUTC(2024, 3, 31)},
+		},
+		{
+			name:    "yearly bymonth",
+			rule:    "FREQ=YEARLY;BYMONTH=3;COUNT=2",
+			dtstart: dateUTC(2024, 1, 15),
+			want:    []time.Time{dateUTC(2024, 3, 15)},
+		},
+		{
+			name:    "monthly byday nth weekday",
+			rule:    "FREQ=MONTHLY;BYDAY=2MO;COUNT=3",
+			dtstart: dateUTC(2024, 1, 8), // the 2nd Monday of January
+			want:    []time.Time{dateUTC(2024, 1, 8), dateUTC(2024, 2, 12), dateUTC(2024, 3, 11)},
+		},
+		{
+			name:    "until is inclusive and ends the series",
+			rule:    "FREQ=DAILY;UNTIL=20240103T090000Z",
+			dtstart: dateUTC(2024, 1, 1),
+			want:    []time.Time{dateUTC(2024, 1, 1), dateUTC(2024, 1, 2), dateUTC(2024, 1, 3)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustParseRecurrenceRule(t, tt.rule)
+			got := r.expand(tt.dtstart, from, to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expand() = %v, want %v", got, tt.want)
+			}
+			for i, g := range got {
+				if !g.Equal(tt.want[i]) {
+					t.Errorf("expand()[%d] = %v, want %v", i, g, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecurrenceRuleWkst(t *testing.T) {
+	// With WKST=SU, the week containing Jan 1 2024 (a Monday) starts on
+	// Dec 31 2023, so the first week's SU candidate falls on Dec 31 —
+	// before dtstart, so it's dropped and the first occurrence is the
+	// following Sunday.
+	r := mustParseRecurrenceRule(t, "FREQ=WEEKLY;BYDAY=SU;WKST=SU;COUNT=2")
+	got := r.expand(dateUTC(2024, 1, 1), dateUTC(2023, 1, 1), dateUTC(2025, 1, 1))
+	want := []time.Time{dateUTC(2024, 1, 7), dateUTC(2024, 1, 14)}
+	if len(got) != len(want) {
+		t.Fatalf("expand() = %v, want %v", got, want)
+	}
+	for i, g := range got {
+		if !g.Equal(want[i]) {
+			t.Errorf("expand()[%d] = %v, want %v", i, g, want[i])
+		}
+	}
+}
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	for _, s := range []string{
+		"INTERVAL=2", // missing FREQ
+		"FREQ=BOGUS",
+		"FREQ=DAILY;BYDAY=XX",
+		"FREQ=DAILY;COUNT=notanumber",
+	} {
+		if _, err := parseRecurrenceRule(s); err == nil {
+			t.Errorf("parseRecurrenceRule(%q): got nil error, want one", s)
+		}
+	}
+}